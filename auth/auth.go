@@ -0,0 +1,318 @@
+// Package auth implements NameDrop's browser-mediated authorization flow,
+// the mechanism by which an application obtains a scoped bearer token for a
+// domain/host without the user ever handing over raw credentials. It is the
+// NameDrop analog of an OAuth authorization-code grant.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+
+	namedrop "github.com/takingnames/namedrop-libdns"
+)
+
+// Recognized scopes for a NameDrop authorization request.
+const (
+	ScopeGetRecords    = "get-records"
+	ScopeCreateRecords = "create-records"
+	ScopeSetRecords    = "set-records"
+	ScopeDeleteRecords = "delete-records"
+)
+
+// Authorizer drives a single NameDrop authorization flow: it builds the
+// authorization-request URL, receives the redirect callback carrying the
+// authorization code, and exchanges that code for a bearer token.
+type Authorizer struct {
+	// ServerUri is the base URI of the NameDrop server. Defaults to
+	// "https://takingnames.io/namedrop".
+	ServerUri string
+	// ClientId identifies the requesting application to the NameDrop server.
+	ClientId string
+	// ClientName is a human-readable application name shown to the user on
+	// the consent screen.
+	ClientName string
+	// RedirectUri is where the NameDrop server sends the user back to after
+	// they approve or deny the request. Its host:port must match the
+	// address AuthorizeInteractive listens on.
+	RedirectUri string
+	// Scopes is the set of permissions being requested, e.g. ScopeGetRecords.
+	Scopes []string
+	// Domain optionally pins the request to a specific domain. Leave empty
+	// to let the user choose at the NameDrop server.
+	Domain string
+	// Host optionally pins the request to a specific host within Domain.
+	Host string
+
+	httpClient *http.Client
+	state      string
+}
+
+// TokenResponse is the result of a completed authorization flow.
+type TokenResponse struct {
+	Token  string
+	Scopes []string
+	Domain string
+	Host   string
+	Expiry time.Time
+}
+
+// authResult carries the outcome of a callback to the goroutine waiting in
+// AuthorizeInteractive.
+type authResult struct {
+	tok *TokenResponse
+	err error
+}
+
+// Provider returns a namedrop.Provider populated with the token obtained
+// from this flow, ready to be passed to the libdns record methods.
+func (tr *TokenResponse) Provider(serverUri string) *namedrop.Provider {
+	return &namedrop.Provider{
+		ServerUri: serverUri,
+		Token:     tr.Token,
+	}
+}
+
+func (a *Authorizer) getServerUri() string {
+	if a.ServerUri == "" {
+		a.ServerUri = "https://takingnames.io/namedrop"
+	}
+	return a.ServerUri
+}
+
+func (a *Authorizer) getClient() *http.Client {
+	if a.httpClient == nil {
+		a.httpClient = &http.Client{}
+	}
+	return a.httpClient
+}
+
+// AuthorizationURL builds the URL the user should be sent to in order to
+// approve (or deny) this authorization request.
+func (a *Authorizer) AuthorizationURL() (string, error) {
+	if a.state == "" {
+		state, err := randomState()
+		if err != nil {
+			return "", fmt.Errorf("generating state: %w", err)
+		}
+		a.state = state
+	}
+
+	q := url.Values{}
+	q.Set("client_id", a.ClientId)
+	q.Set("redirect_uri", a.RedirectUri)
+	q.Set("scope", strings.Join(a.Scopes, " "))
+	q.Set("state", a.state)
+
+	if a.ClientName != "" {
+		q.Set("client_name", a.ClientName)
+	}
+	if a.Domain != "" {
+		q.Set("domain", a.Domain)
+	}
+	if a.Host != "" {
+		q.Set("host", a.Host)
+	}
+
+	return fmt.Sprintf("%s/authorize?%s", a.getServerUri(), q.Encode()), nil
+}
+
+// AuthorizeInteractive opens the user's browser to the authorization URL,
+// listens on listenAddr for the redirect callback, and blocks until the
+// flow completes, fails, or ctx is canceled.
+func (a *Authorizer) AuthorizeInteractive(ctx context.Context, listenAddr string) (*TokenResponse, error) {
+	authUrl, err := a.AuthorizationURL()
+	if err != nil {
+		return nil, err
+	}
+
+	resultCh := make(chan authResult, 1)
+
+	callbackPath, err := a.redirectPath()
+	if err != nil {
+		return nil, err
+	}
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		return nil, fmt.Errorf("listening on %s: %w", listenAddr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle(callbackPath, a.callbackHandler(resultCh))
+
+	server := &http.Server{Handler: mux}
+	go server.Serve(ln)
+	defer server.Close()
+
+	if err := openBrowser(authUrl); err != nil {
+		return nil, fmt.Errorf("opening browser: %w", err)
+	}
+
+	select {
+	case res := <-resultCh:
+		return res.tok, res.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// redirectPath extracts the path component of RedirectUri, so the callback
+// handler can be mounted on just that path instead of handling every
+// request the listener receives (favicon fetches, probes, etc.).
+func (a *Authorizer) redirectPath() (string, error) {
+	u, err := url.Parse(a.RedirectUri)
+	if err != nil {
+		return "", fmt.Errorf("parsing redirect_uri: %w", err)
+	}
+	if u.Path == "" {
+		return "/", nil
+	}
+	return u.Path, nil
+}
+
+// callbackHandler returns the http.Handler that receives the NameDrop
+// redirect and reports the outcome on resultCh.
+func (a *Authorizer) callbackHandler(resultCh chan<- authResult) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+
+		if msg := q.Get("error"); msg != "" {
+			http.Error(w, "Authorization denied", http.StatusBadRequest)
+			resultCh <- authResult{err: fmt.Errorf("authorization denied: %s", msg)}
+			return
+		}
+
+		if q.Get("state") != a.state {
+			http.Error(w, "State mismatch", http.StatusBadRequest)
+			resultCh <- authResult{err: fmt.Errorf("state mismatch")}
+			return
+		}
+
+		code := q.Get("code")
+		if code == "" {
+			http.Error(w, "Missing authorization code", http.StatusBadRequest)
+			resultCh <- authResult{err: fmt.Errorf("missing authorization code")}
+			return
+		}
+
+		tok, err := a.exchangeCode(r.Context(), code)
+		if err != nil {
+			http.Error(w, "Token exchange failed", http.StatusInternalServerError)
+			resultCh <- authResult{err: err}
+			return
+		}
+
+		tok.Domain = q.Get("domain")
+		tok.Host = q.Get("host")
+
+		fmt.Fprintln(w, "Authorization complete. You may close this window.")
+		resultCh <- authResult{tok: tok}
+	})
+}
+
+type tokenExchangeRequest struct {
+	ClientId    string `json:"client_id"`
+	Code        string `json:"code"`
+	RedirectUri string `json:"redirect_uri"`
+}
+
+type tokenExchangeResponse struct {
+	Token     string   `json:"token"`
+	Scopes    []string `json:"scopes,omitempty"`
+	ExpiresIn int      `json:"expires_in,omitempty"`
+}
+
+// exchangeCode trades an authorization code for a bearer token by POSTing
+// to the NameDrop server's /token endpoint.
+func (a *Authorizer) exchangeCode(ctx context.Context, code string) (*TokenResponse, error) {
+	reqBody, err := json.Marshal(&tokenExchangeRequest{
+		ClientId:    a.ClientId,
+		Code:        code,
+		RedirectUri: a.RedirectUri,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	uri := fmt.Sprintf("%s/token", a.getServerUri())
+
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, strings.NewReader(string(reqBody)))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	res, err := a.getClient().Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	resBody, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token exchange failed with status %d: %s", res.StatusCode, tokenExchangeErrorMessage(resBody))
+	}
+
+	var tokRes tokenExchangeResponse
+	if err := json.Unmarshal(resBody, &tokRes); err != nil {
+		return nil, err
+	}
+
+	tok := &TokenResponse{
+		Token:  tokRes.Token,
+		Scopes: tokRes.Scopes,
+	}
+	if tokRes.ExpiresIn > 0 {
+		tok.Expiry = time.Now().Add(time.Duration(tokRes.ExpiresIn) * time.Second)
+	}
+
+	return tok, nil
+}
+
+// tokenExchangeErrorMessage extracts a human-readable message from a
+// failed /token response, falling back to the raw body if it isn't the
+// expected JSON error shape.
+func tokenExchangeErrorMessage(body []byte) string {
+	var errRes struct {
+		Message string `json:"message"`
+	}
+	if err := json.Unmarshal(body, &errRes); err == nil && errRes.Message != "" {
+		return errRes.Message
+	}
+	return strings.TrimSpace(string(body))
+}
+
+func randomState() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// openBrowser launches the system's default browser pointed at uri.
+func openBrowser(uri string) error {
+	switch runtime.GOOS {
+	case "darwin":
+		return exec.Command("open", uri).Start()
+	case "windows":
+		return exec.Command("rundll32", "url.dll,FileProtocolHandler", uri).Start()
+	default:
+		return exec.Command("xdg-open", uri).Start()
+	}
+}
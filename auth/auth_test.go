@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestExchangeCodeSurfacesServerErrorBeforeDecoding(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write([]byte("not json"))
+	}))
+	defer srv.Close()
+
+	a := &Authorizer{ServerUri: srv.URL}
+
+	_, err := a.exchangeCode(context.Background(), "some-code")
+	if err == nil {
+		t.Fatal("expected an error for a non-OK response, got nil")
+	}
+	if !strings.Contains(err.Error(), "status 400") {
+		t.Fatalf("expected the status code in the error, got: %v", err)
+	}
+	if !strings.Contains(err.Error(), "not json") {
+		t.Fatalf("expected the server's body in the error, got: %v", err)
+	}
+}
+
+func TestExchangeCodeSurfacesJSONErrorMessage(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"message":"code expired"}`))
+	}))
+	defer srv.Close()
+
+	a := &Authorizer{ServerUri: srv.URL}
+
+	_, err := a.exchangeCode(context.Background(), "some-code")
+	if err == nil {
+		t.Fatal("expected an error for a non-OK response, got nil")
+	}
+	if !strings.Contains(err.Error(), "code expired") {
+		t.Fatalf("expected the server's error message in the error, got: %v", err)
+	}
+}
+
+func TestExchangeCodeParsesSuccessResponse(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"token":"abc123","scopes":["get-records"],"expires_in":3600}`))
+	}))
+	defer srv.Close()
+
+	a := &Authorizer{ServerUri: srv.URL}
+
+	tok, err := a.exchangeCode(context.Background(), "some-code")
+	if err != nil {
+		t.Fatalf("exchangeCode: %v", err)
+	}
+	if tok.Token != "abc123" {
+		t.Errorf("Token = %q, want %q", tok.Token, "abc123")
+	}
+	if len(tok.Scopes) != 1 || tok.Scopes[0] != "get-records" {
+		t.Errorf("Scopes = %v, want [get-records]", tok.Scopes)
+	}
+	if tok.Expiry.IsZero() {
+		t.Error("expected a non-zero Expiry from expires_in")
+	}
+}
@@ -0,0 +1,267 @@
+// Command namedrop is a small CLI wrapper around the namedrop libdns
+// Provider, for managing DNS records and obtaining a NameDrop token without
+// writing any Go.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	namedrop "github.com/takingnames/namedrop-libdns"
+	"github.com/takingnames/namedrop-libdns/auth"
+	"github.com/libdns/libdns"
+)
+
+func main() {
+	if len(os.Args) < 2 {
+		usage()
+		os.Exit(1)
+	}
+
+	var err error
+
+	switch os.Args[1] {
+	case "list":
+		err = runList(os.Args[2:])
+	case "add":
+		err = runAdd(os.Args[2:])
+	case "set":
+		err = runSet(os.Args[2:])
+	case "delete":
+		err = runDelete(os.Args[2:])
+	case "login":
+		err = runLogin(os.Args[2:])
+	default:
+		usage()
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "namedrop:", err)
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: namedrop <list|add|set|delete|login> [flags]")
+}
+
+// recordFlags holds the flags shared by the record-manipulation
+// subcommands.
+type recordFlags struct {
+	domain   string
+	host     string
+	typ      string
+	value    string
+	ttl      int
+	priority uint
+	server   string
+	out      string
+}
+
+func parseRecordFlags(name string, args []string, needsValue bool) (*recordFlags, error) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+
+	f := &recordFlags{}
+	fs.StringVar(&f.domain, "domain", "", "domain to operate on (required)")
+	fs.StringVar(&f.host, "host", "", "host/subdomain, relative to -domain")
+	fs.StringVar(&f.typ, "type", "", "record type, e.g. A, AAAA, CNAME, TXT, MX, SRV, CAA, TLSA")
+	fs.StringVar(&f.value, "value", "", "record value")
+	fs.IntVar(&f.ttl, "ttl", 300, "record TTL in seconds")
+	fs.UintVar(&f.priority, "priority", 0, "record priority/preference")
+	fs.StringVar(&f.server, "server", "", "NameDrop server URI, overrides the stored default")
+	fs.StringVar(&f.out, "o", "", "write the resulting records as JSON to this path, or - for stdout")
+
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if f.domain == "" {
+		return nil, fmt.Errorf("-domain is required")
+	}
+	if needsValue && f.value == "" {
+		return nil, fmt.Errorf("-value is required")
+	}
+
+	return f, nil
+}
+
+func (f *recordFlags) record() libdns.Record {
+	return libdns.Record{
+		Name:     f.host,
+		Type:     f.typ,
+		Value:    f.value,
+		TTL:      time.Duration(f.ttl) * time.Second,
+		Priority: f.priority,
+	}
+}
+
+func newProvider(server string) (*namedrop.Provider, error) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	if server == "" {
+		server = cfg.ServerUri
+	}
+
+	if cfg.Token == "" {
+		return nil, fmt.Errorf("not logged in, run `namedrop login` first")
+	}
+
+	return &namedrop.Provider{
+		ServerUri: server,
+		Token:     cfg.Token,
+	}, nil
+}
+
+func runList(args []string) error {
+	f, err := parseRecordFlags("list", args, false)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(f.server)
+	if err != nil {
+		return err
+	}
+
+	records, err := p.GetRecords(context.Background(), f.domain)
+	if err != nil {
+		return err
+	}
+
+	return outputRecords(records, f.out)
+}
+
+func runAdd(args []string) error {
+	f, err := parseRecordFlags("add", args, true)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(f.server)
+	if err != nil {
+		return err
+	}
+
+	records, err := p.AppendRecords(context.Background(), f.domain, []libdns.Record{f.record()})
+	if err != nil {
+		return err
+	}
+
+	return outputRecords(records, f.out)
+}
+
+func runSet(args []string) error {
+	f, err := parseRecordFlags("set", args, true)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(f.server)
+	if err != nil {
+		return err
+	}
+
+	records, err := p.SetRecords(context.Background(), f.domain, []libdns.Record{f.record()})
+	if err != nil {
+		return err
+	}
+
+	return outputRecords(records, f.out)
+}
+
+func runDelete(args []string) error {
+	f, err := parseRecordFlags("delete", args, true)
+	if err != nil {
+		return err
+	}
+
+	p, err := newProvider(f.server)
+	if err != nil {
+		return err
+	}
+
+	records, err := p.DeleteRecords(context.Background(), f.domain, []libdns.Record{f.record()})
+	if err != nil {
+		return err
+	}
+
+	return outputRecords(records, f.out)
+}
+
+func runLogin(args []string) error {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+
+	server := fs.String("server", "", "NameDrop server URI")
+	clientId := fs.String("client-id", "namedrop-cli", "client ID to present to the NameDrop server")
+	domain := fs.String("domain", "", "restrict the request to this domain")
+	host := fs.String("host", "", "restrict the request to this host")
+	listenAddr := fs.String("listen", "127.0.0.1:8080", "address to listen on for the authorization callback")
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	authorizer := &auth.Authorizer{
+		ServerUri:   *server,
+		ClientId:    *clientId,
+		ClientName:  "namedrop CLI",
+		RedirectUri: fmt.Sprintf("http://%s/callback", *listenAddr),
+		Scopes: []string{
+			auth.ScopeGetRecords,
+			auth.ScopeCreateRecords,
+			auth.ScopeSetRecords,
+			auth.ScopeDeleteRecords,
+		},
+		Domain: *domain,
+		Host:   *host,
+	}
+
+	fmt.Println("Opening your browser to complete authorization...")
+
+	tok, err := authorizer.AuthorizeInteractive(context.Background(), *listenAddr)
+	if err != nil {
+		return fmt.Errorf("authorizing: %w", err)
+	}
+
+	cfg := &config{
+		ServerUri: *server,
+		Token:     tok.Token,
+	}
+
+	if err := saveConfig(cfg); err != nil {
+		return fmt.Errorf("saving config: %w", err)
+	}
+
+	fmt.Println("Logged in.")
+	return nil
+}
+
+func outputRecords(records []libdns.Record, out string) error {
+	if out == "" {
+		for _, rec := range records {
+			fmt.Printf("%s\t%s\t%s\tttl=%s\tpriority=%d\n",
+				rec.Name, rec.Type, rec.Value, rec.TTL, rec.Priority)
+		}
+		return nil
+	}
+
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if out == "-" {
+		_, err := os.Stdout.Write(append(data, '\n'))
+		return err
+	}
+
+	return os.WriteFile(out, data, 0644)
+}
@@ -9,14 +9,22 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
+	"math/rand"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/libdns/libdns"
 )
 
+const (
+	defaultMaxRetries        = 3
+	defaultRetryInitialDelay = 500 * time.Millisecond
+	defaultRetryMaxDelay     = 30 * time.Second
+)
+
 type NamedropRequest struct {
 	Domain  string            `json:"domain,omitempty"`
 	Host    string            `json:"host,omitempty"`
@@ -27,24 +35,82 @@ type NamedropRequest struct {
 type NamedropResponse struct {
 	Type    string            `json:"type,omitempty"`
 	Records []*NamedropRecord `json:"records,omitempty"`
+	Domains []*NamedropDomain `json:"domains,omitempty"`
+}
+
+// NamedropDomain describes a domain the requesting token grants access to,
+// as reported by /list-domains.
+type NamedropDomain struct {
+	Domain string   `json:"domain,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
 }
 
 type NamedropRecord struct {
+	Id       string `json:"id,omitempty"`
 	Domain   string `json:"domain,omitempty"`
 	Host     string `json:"host,omitempty"`
 	Type     string `json:"type,omitempty"`
 	Value    string `json:"value,omitempty"`
 	Ttl      int    `json:"ttl,omitempty"`
 	Priority int    `json:"priority,omitempty"`
+
+	// Weight and Port are used by SRV records.
+	Weight int `json:"weight,omitempty"`
+	Port   int `json:"port,omitempty"`
+
+	// Flags and Tag are used by CAA records.
+	Flags int    `json:"flags,omitempty"`
+	Tag   string `json:"tag,omitempty"`
+
+	// Usage, Selector, and MatchingType are used by TLSA records.
+	Usage        int `json:"usage,omitempty"`
+	Selector     int `json:"selector,omitempty"`
+	MatchingType int `json:"matching_type,omitempty"`
 }
 
 // Provider facilitates DNS record manipulation with NameDrop.
 type Provider struct {
-	ServerUri  string `json:"server_uri,omitempty"`
-	Token      string `json:"token,omitempty"`
+	ServerUri string `json:"server_uri,omitempty"`
+	Token     string `json:"token,omitempty"`
+
+	// MaxRetries is the number of times a request is retried after a
+	// network error, a 5xx response, or a 429 response. Defaults to 3.
+	MaxRetries int `json:"max_retries,omitempty"`
+	// RetryInitialDelay is the delay before the first retry. Subsequent
+	// retries back off exponentially from this value. Defaults to 500ms.
+	RetryInitialDelay time.Duration `json:"-"`
+	// RetryMaxDelay caps the exponential backoff delay. Defaults to 30s.
+	RetryMaxDelay time.Duration `json:"-"`
+
+	// IncrementalSync, when true, makes SetRecords diff the desired records
+	// against the zone's current records and issue only the creates,
+	// updates, and deletes needed to reconcile them, instead of forwarding
+	// the whole list to /set-records.
+	IncrementalSync bool `json:"incremental_sync,omitempty"`
+
 	httpClient *http.Client
 }
 
+// APIError represents a structured error response returned by the NameDrop
+// API.
+type APIError struct {
+	StatusCode int    `json:"-"`
+	Code       string `json:"code,omitempty"`
+	Message    string `json:"message,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	if e.Code != "" {
+		return fmt.Sprintf("namedrop: %s (status %d): %s", e.Code, e.StatusCode, e.Message)
+	}
+	return fmt.Sprintf("namedrop: status %d: %s", e.StatusCode, e.Message)
+}
+
+// WithHTTPClient overrides the http.Client used for NameDrop API requests.
+func (p *Provider) WithHTTPClient(client *http.Client) {
+	p.httpClient = client
+}
+
 // GetRecords lists all the records in the zone.
 func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record, error) {
 
@@ -53,7 +119,7 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 		Token:  p.Token,
 	}
 
-	ndRes, err := p.namedropRequest("/get-records", ndReq)
+	ndRes, err := p.namedropRequest(ctx, "/get-records", ndReq)
 	if err != nil {
 		return nil, err
 	}
@@ -63,20 +129,162 @@ func (p *Provider) GetRecords(ctx context.Context, zone string) ([]libdns.Record
 	return records, nil
 }
 
+// ListZones lists the zones/domains the Provider's token grants access to.
+func (p *Provider) ListZones(ctx context.Context) ([]libdns.Zone, error) {
+	ndReq := &NamedropRequest{
+		Token: p.Token,
+	}
+
+	ndRes, err := p.namedropRequest(ctx, "/list-domains", ndReq)
+	if err != nil {
+		return nil, err
+	}
+
+	zones := make([]libdns.Zone, len(ndRes.Domains))
+	for i, d := range ndRes.Domains {
+		zones[i] = libdns.Zone{Name: d.Domain}
+	}
+
+	return zones, nil
+}
+
 // AppendRecords adds records to the zone. It returns the records that were added.
 func (p *Provider) AppendRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	return p.mutateRequest(zoneToDomain(zone), "/create-records", records)
+	return p.mutateRequest(ctx, zoneToDomain(zone), "/create-records", records)
 }
 
 // SetRecords sets the records in the zone, either by updating existing records or creating new ones.
 // It returns the updated records.
+//
+// If p.IncrementalSync is set, SetRecords first fetches the zone's current
+// records and issues only the creates, updates, and deletes needed to make
+// it match records, rather than forwarding the whole list to /set-records.
 func (p *Provider) SetRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	return p.mutateRequest(zoneToDomain(zone), "/set-records", records)
+	if !p.IncrementalSync {
+		return p.mutateRequest(ctx, zoneToDomain(zone), "/set-records", records)
+	}
+
+	actual, err := p.GetRecords(ctx, zone)
+	if err != nil {
+		return nil, err
+	}
+
+	domain := zoneToDomain(zone)
+	creates, updates, deletes := diffRecords(records, actual)
+
+	if len(creates) > 0 {
+		if _, err := p.mutateRequest(ctx, domain, "/create-records", creates); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(updates) > 0 {
+		if _, err := p.mutateRequest(ctx, domain, "/set-records", updates); err != nil {
+			return nil, err
+		}
+	}
+
+	if len(deletes) > 0 {
+		if _, err := p.mutateRequest(ctx, domain, "/delete-records", deletes); err != nil {
+			return nil, err
+		}
+	}
+
+	return records, nil
+}
+
+// recordKey identifies a record within an RRset for diffing purposes.
+// Keying on value (not just name/type) lets multi-valued RRsets - e.g. the
+// several TXT records used for ACME challenges - be compared value by
+// value instead of as an opaque block.
+type recordKey struct {
+	name  string
+	typ   string
+	value string
+}
+
+func keyOf(rec libdns.Record) recordKey {
+	return recordKey{name: rec.Name, typ: rec.Type, value: rec.Value}
+}
+
+// nameType identifies the RRset - all records sharing a (name, type) - that
+// a record belongs to. /set-records and /delete-records act on whole
+// RRsets, so that's the unit diffRecords batches its creates/updates/
+// deletes by.
+func nameType(rec libdns.Record) string {
+	return rec.Name + "|" + rec.Type
+}
+
+// diffRecords computes the minimal set of creates, updates, and deletes
+// needed to make a zone's actual records match desired, batched by RRset
+// (name, type):
+//   - an RRset present in desired but not actual is a create
+//   - an RRset present in actual but not desired is a delete
+//   - an RRset present in both, but differing (by value, TTL, or priority
+//     for any record in it), is an update - the *entire* desired RRset is
+//     included, not just the changed record(s), since /set-records
+//     replaces every record under the (name, type) pairs it's given and a
+//     partial batch would drop the untouched siblings.
+func diffRecords(desired, actual []libdns.Record) (creates, updates, deletes []libdns.Record) {
+	actualByNameType := map[string][]libdns.Record{}
+	for _, rec := range actual {
+		nt := nameType(rec)
+		actualByNameType[nt] = append(actualByNameType[nt], rec)
+	}
+
+	desiredByNameType := map[string][]libdns.Record{}
+	for _, rec := range desired {
+		nt := nameType(rec)
+		desiredByNameType[nt] = append(desiredByNameType[nt], rec)
+	}
+
+	for nt, desiredRRset := range desiredByNameType {
+		actualRRset, ok := actualByNameType[nt]
+		if !ok {
+			creates = append(creates, desiredRRset...)
+			continue
+		}
+
+		if !rrsetsEqual(desiredRRset, actualRRset) {
+			updates = append(updates, desiredRRset...)
+		}
+	}
+
+	for nt, actualRRset := range actualByNameType {
+		if _, ok := desiredByNameType[nt]; !ok {
+			deletes = append(deletes, actualRRset...)
+		}
+	}
+
+	return creates, updates, deletes
+}
+
+// rrsetsEqual reports whether two same-(name,type) record sets carry the
+// same records, ignoring order. Records are matched by (name, type, value)
+// so multi-valued RRsets compare value by value.
+func rrsetsEqual(a, b []libdns.Record) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	bByKey := map[recordKey]libdns.Record{}
+	for _, rec := range b {
+		bByKey[keyOf(rec)] = rec
+	}
+
+	for _, rec := range a {
+		other, ok := bByKey[keyOf(rec)]
+		if !ok || other.TTL != rec.TTL || other.Priority != rec.Priority {
+			return false
+		}
+	}
+
+	return true
 }
 
 // DeleteRecords deletes the records from the zone. It returns the records that were deleted.
 func (p *Provider) DeleteRecords(ctx context.Context, zone string, records []libdns.Record) ([]libdns.Record, error) {
-	return p.mutateRequest(zoneToDomain(zone), "/delete-records", records)
+	return p.mutateRequest(ctx, zoneToDomain(zone), "/delete-records", records)
 }
 
 func (p *Provider) getServerUri() string {
@@ -93,8 +301,32 @@ func (p *Provider) getClient() *http.Client {
 	return p.httpClient
 }
 
-func (p *Provider) mutateRequest(zone, endpoint string, records []libdns.Record) ([]libdns.Record, error) {
-	ndRecs := libdnsRecordsToNamedropRecords(records)
+func (p *Provider) getMaxRetries() int {
+	if p.MaxRetries == 0 {
+		return defaultMaxRetries
+	}
+	return p.MaxRetries
+}
+
+func (p *Provider) getRetryInitialDelay() time.Duration {
+	if p.RetryInitialDelay == 0 {
+		return defaultRetryInitialDelay
+	}
+	return p.RetryInitialDelay
+}
+
+func (p *Provider) getRetryMaxDelay() time.Duration {
+	if p.RetryMaxDelay == 0 {
+		return defaultRetryMaxDelay
+	}
+	return p.RetryMaxDelay
+}
+
+func (p *Provider) mutateRequest(ctx context.Context, zone, endpoint string, records []libdns.Record) ([]libdns.Record, error) {
+	ndRecs, err := libdnsRecordsToNamedropRecords(records)
+	if err != nil {
+		return nil, err
+	}
 
 	ndReq := &NamedropRequest{
 		Domain:  zoneToDomain(zone),
@@ -102,7 +334,7 @@ func (p *Provider) mutateRequest(zone, endpoint string, records []libdns.Record)
 		Records: ndRecs,
 	}
 
-	ndRes, err := p.namedropRequest(endpoint, ndReq)
+	ndRes, err := p.namedropRequest(ctx, endpoint, ndReq)
 	if err != nil {
 		return nil, err
 	}
@@ -110,9 +342,10 @@ func (p *Provider) mutateRequest(zone, endpoint string, records []libdns.Record)
 	return namedropRecordsToLibdnsRecords(ndRes.Records), nil
 }
 
-func (p *Provider) namedropRequest(endpoint string, req *NamedropRequest) (*NamedropResponse, error) {
-
-	client := p.getClient()
+// namedropRequest POSTs req to the given NameDrop API endpoint, retrying on
+// network errors, 5xx responses, and 429 responses with exponential
+// backoff and jitter. It honors ctx cancellation between attempts.
+func (p *Provider) namedropRequest(ctx context.Context, endpoint string, req *NamedropRequest) (*NamedropResponse, error) {
 
 	uri := fmt.Sprintf("%s%s", p.getServerUri(), endpoint)
 
@@ -121,58 +354,230 @@ func (p *Provider) namedropRequest(endpoint string, req *NamedropRequest) (*Name
 		return nil, err
 	}
 
-	res, err := client.Post(uri, "application/json", bytes.NewBuffer(reqBytes))
+	maxRetries := p.getMaxRetries()
+
+	var lastErr error
+	var retryAfter time.Duration
+
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			if err := p.waitForRetry(ctx, attempt, retryAfter); err != nil {
+				return nil, err
+			}
+		}
+
+		ndRes, ra, err := p.doNamedropRequest(ctx, uri, reqBytes)
+		if err == nil {
+			return ndRes, nil
+		}
+
+		lastErr = err
+		retryAfter = ra
+
+		if attempt == maxRetries || !isRetryable(err) {
+			return nil, err
+		}
+	}
+
+	return nil, lastErr
+}
+
+// doNamedropRequest performs a single attempt. When the response is a 429,
+// the returned duration reflects the server's requested Retry-After.
+func (p *Provider) doNamedropRequest(ctx context.Context, uri string, reqBytes []byte) (*NamedropResponse, time.Duration, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, uri, bytes.NewBuffer(reqBytes))
 	if err != nil {
-		return nil, err
+		return nil, 0, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	res, err := p.getClient().Do(httpReq)
+	if err != nil {
+		return nil, 0, err
 	}
 	defer res.Body.Close()
 
 	bodyBytes, err := io.ReadAll(res.Body)
 	if err != nil {
-		return nil, err
+		return nil, 0, err
 	}
 
-	if res.StatusCode != 200 {
-		return nil, fmt.Errorf("Bad status code %d: %s\n", res.StatusCode, string(bodyBytes))
+	if res.StatusCode != http.StatusOK {
+		apiErr := parseAPIError(res.StatusCode, bodyBytes)
+
+		var retryAfter time.Duration
+		if res.StatusCode == http.StatusTooManyRequests {
+			retryAfter, _ = parseRetryAfter(res.Header.Get("Retry-After"))
+		}
+
+		return nil, retryAfter, apiErr
 	}
 
 	var ndRes *NamedropResponse
+	if err := json.Unmarshal(bodyBytes, &ndRes); err != nil {
+		return nil, 0, err
+	}
 
-	err = json.Unmarshal(bodyBytes, &ndRes)
-	if err != nil {
-		return nil, err
+	return ndRes, 0, nil
+}
+
+// waitForRetry sleeps out the delay before the given attempt number
+// (1-indexed), or returns ctx.Err() if ctx is canceled first. The delay is
+// the larger of the exponential backoff and the server-provided
+// Retry-After from the previous attempt (zero if none was given), so the
+// two don't stack on top of each other.
+func (p *Provider) waitForRetry(ctx context.Context, attempt int, retryAfter time.Duration) error {
+	delay := backoffDelay(p.getRetryInitialDelay(), p.getRetryMaxDelay(), attempt)
+	if retryAfter > delay {
+		delay = retryAfter
+	}
+
+	select {
+	case <-time.After(delay):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func isRetryable(err error) bool {
+	apiErr, ok := err.(*APIError)
+	if !ok {
+		// Network-level errors (timeouts, connection resets, etc.) are
+		// always worth retrying.
+		return true
+	}
+	return apiErr.StatusCode >= 500 || apiErr.StatusCode == http.StatusTooManyRequests
+}
+
+// backoffDelay computes an exponentially increasing delay for the given
+// 1-indexed attempt, capped at max, with up to 50% jitter applied.
+func backoffDelay(initial, max time.Duration, attempt int) time.Duration {
+	delay := initial * time.Duration(1<<uint(attempt-1))
+	if delay > max || delay <= 0 {
+		delay = max
+	}
+
+	jitter := time.Duration(rand.Int63n(int64(delay)/2 + 1))
+	return delay/2 + jitter
+}
+
+// parseRetryAfter parses a Retry-After header in either the delta-seconds
+// or HTTP-date form.
+func parseRetryAfter(header string) (time.Duration, error) {
+	if header == "" {
+		return 0, fmt.Errorf("empty Retry-After header")
+	}
+
+	if secs, err := strconv.Atoi(header); err == nil {
+		return time.Duration(secs) * time.Second, nil
 	}
 
-	return ndRes, nil
+	if t, err := http.ParseTime(header); err == nil {
+		return time.Until(t), nil
+	}
+
+	return 0, fmt.Errorf("unrecognized Retry-After format: %s", header)
 }
 
-func libdnsRecordsToNamedropRecords(records []libdns.Record) []*NamedropRecord {
+func parseAPIError(statusCode int, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: statusCode}
+
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Message == "" {
+		apiErr.Message = strings.TrimSpace(string(body))
+	}
+
+	return apiErr
+}
+
+func libdnsRecordsToNamedropRecords(records []libdns.Record) ([]*NamedropRecord, error) {
 
 	ndRecs := []*NamedropRecord{}
 	for _, rec := range records {
 		ndRec := &NamedropRecord{
-			Host:  rec.Name,
-			Type:  rec.Type,
-			Value: rec.Value,
-			//Ttl: int(rec.TTL),
-			Priority: rec.Priority,
+			Id:       rec.ID,
+			Host:     rec.Name,
+			Type:     rec.Type,
+			Value:    rec.Value,
+			Ttl:      int(rec.TTL / time.Second),
+			Priority: int(rec.Priority),
+		}
+
+		switch strings.ToUpper(rec.Type) {
+		case "SRV":
+			fields := strings.Fields(rec.Value)
+			if len(fields) != 2 {
+				return nil, fmt.Errorf("malformed SRV value %q for %s: expected '<port> <target>'", rec.Value, rec.Name)
+			}
+			port, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid SRV port %q for %s: %w", fields[0], rec.Name, err)
+			}
+			ndRec.Weight = int(rec.Weight)
+			ndRec.Port = port
+			ndRec.Value = fields[1]
+		case "CAA":
+			fields := strings.SplitN(rec.Value, " ", 3)
+			if len(fields) != 3 {
+				return nil, fmt.Errorf("malformed CAA value %q for %s: expected '<flags> <tag> <value>'", rec.Value, rec.Name)
+			}
+			flags, err := strconv.Atoi(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("invalid CAA flags %q for %s: %w", fields[0], rec.Name, err)
+			}
+			ndRec.Flags = flags
+			ndRec.Tag = fields[1]
+			ndRec.Value = fields[2]
+		case "TLSA":
+			fields := strings.SplitN(rec.Value, " ", 4)
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("malformed TLSA value %q for %s: expected '<usage> <selector> <matching_type> <cert data>'", rec.Value, rec.Name)
+			}
+			var err error
+			if ndRec.Usage, err = strconv.Atoi(fields[0]); err != nil {
+				return nil, fmt.Errorf("invalid TLSA usage %q for %s: %w", fields[0], rec.Name, err)
+			}
+			if ndRec.Selector, err = strconv.Atoi(fields[1]); err != nil {
+				return nil, fmt.Errorf("invalid TLSA selector %q for %s: %w", fields[1], rec.Name, err)
+			}
+			if ndRec.MatchingType, err = strconv.Atoi(fields[2]); err != nil {
+				return nil, fmt.Errorf("invalid TLSA matching_type %q for %s: %w", fields[2], rec.Name, err)
+			}
+			ndRec.Value = fields[3]
 		}
+
 		ndRecs = append(ndRecs, ndRec)
 	}
 
-	return ndRecs
+	return ndRecs, nil
 }
 
 func namedropRecordsToLibdnsRecords(ndRecs []*NamedropRecord) []libdns.Record {
 	records := []libdns.Record{}
 
 	for _, ndRec := range ndRecs {
+		value := ndRec.Value
+
+		var weight uint
+
+		switch strings.ToUpper(ndRec.Type) {
+		case "SRV":
+			value = fmt.Sprintf("%d %s", ndRec.Port, ndRec.Value)
+			weight = uint(ndRec.Weight)
+		case "CAA":
+			value = fmt.Sprintf("%d %s %s", ndRec.Flags, ndRec.Tag, ndRec.Value)
+		case "TLSA":
+			value = fmt.Sprintf("%d %d %d %s", ndRec.Usage, ndRec.Selector, ndRec.MatchingType, ndRec.Value)
+		}
+
 		record := libdns.Record{
+			ID:       ndRec.Id,
 			Name:     ndRec.Host,
 			Type:     ndRec.Type,
-			Value:    ndRec.Value,
+			Value:    value,
 			TTL:      time.Second * time.Duration(ndRec.Ttl),
-			Priority: ndRec.Priority,
+			Priority: uint(ndRec.Priority),
+			Weight:   weight,
 		}
 		records = append(records, record)
 	}
@@ -198,4 +603,5 @@ var (
 	_ libdns.RecordAppender = (*Provider)(nil)
 	_ libdns.RecordSetter   = (*Provider)(nil)
 	_ libdns.RecordDeleter  = (*Provider)(nil)
+	_ libdns.ZoneLister     = (*Provider)(nil)
 )
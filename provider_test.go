@@ -0,0 +1,216 @@
+package namedrop
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/libdns/libdns"
+)
+
+func TestDiffRecordsPreservesUntouchedRRsetSiblings(t *testing.T) {
+	actual := []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "aaa", TTL: 300 * time.Second},
+		{Name: "_acme-challenge", Type: "TXT", Value: "bbb", TTL: 300 * time.Second},
+	}
+
+	desired := []libdns.Record{
+		{Name: "_acme-challenge", Type: "TXT", Value: "aaa-new", TTL: 300 * time.Second},
+		{Name: "_acme-challenge", Type: "TXT", Value: "bbb", TTL: 300 * time.Second},
+	}
+
+	creates, updates, deletes := diffRecords(desired, actual)
+
+	if len(creates) != 0 {
+		t.Fatalf("expected no creates, got %v", creates)
+	}
+	if len(deletes) != 0 {
+		t.Fatalf("expected no deletes, got %v", deletes)
+	}
+
+	if len(updates) != len(desired) {
+		t.Fatalf("expected the full desired RRset in updates so /set-records doesn't drop siblings, got %v", updates)
+	}
+
+	seen := map[string]bool{}
+	for _, rec := range updates {
+		seen[rec.Value] = true
+	}
+	for _, rec := range desired {
+		if !seen[rec.Value] {
+			t.Fatalf("updates missing sibling record %q", rec.Value)
+		}
+	}
+}
+
+func TestDiffRecordsCreatesAndDeletesByRRset(t *testing.T) {
+	actual := []libdns.Record{
+		{Name: "stale", Type: "A", Value: "1.1.1.1"},
+	}
+
+	desired := []libdns.Record{
+		{Name: "fresh", Type: "A", Value: "2.2.2.2"},
+	}
+
+	creates, updates, deletes := diffRecords(desired, actual)
+
+	if len(updates) != 0 {
+		t.Fatalf("expected no updates, got %v", updates)
+	}
+	if len(creates) != 1 || creates[0].Name != "fresh" {
+		t.Fatalf("expected fresh to be created, got %v", creates)
+	}
+	if len(deletes) != 1 || deletes[0].Name != "stale" {
+		t.Fatalf("expected stale to be deleted, got %v", deletes)
+	}
+}
+
+// roundTrip converts rec to a NamedropRecord and back, the same way
+// mutateRequest and GetRecords do on either side of the wire.
+func roundTrip(t *testing.T, rec libdns.Record) libdns.Record {
+	t.Helper()
+
+	ndRecs, err := libdnsRecordsToNamedropRecords([]libdns.Record{rec})
+	if err != nil {
+		t.Fatalf("libdnsRecordsToNamedropRecords: %v", err)
+	}
+
+	out := namedropRecordsToLibdnsRecords(ndRecs)
+	if len(out) != 1 {
+		t.Fatalf("expected 1 record back, got %d", len(out))
+	}
+
+	return out[0]
+}
+
+func TestRecordConversionSRVRoundTrip(t *testing.T) {
+	// Built the way libdns itself constructs an SRV record, so this also
+	// guards against drifting from libdns's own "<port> <target>" Value
+	// convention.
+	srv := libdns.SRV{
+		Service:  "sip",
+		Proto:    "tcp",
+		Name:     "example.com",
+		Priority: 10,
+		Weight:   20,
+		Port:     5060,
+		Target:   "sipserver.example.com",
+	}
+	rec := srv.ToRecord()
+	rec.TTL = 300 * time.Second
+
+	out := roundTrip(t, rec)
+
+	if out.Priority != 10 {
+		t.Errorf("Priority = %d, want 10", out.Priority)
+	}
+	if out.Weight != 20 {
+		t.Errorf("Weight = %d, want 20", out.Weight)
+	}
+	if out.Value != rec.Value {
+		t.Errorf("Value = %q, want %q", out.Value, rec.Value)
+	}
+
+	gotSRV, err := out.ToSRV()
+	if err != nil {
+		t.Fatalf("round-tripped record failed ToSRV: %v", err)
+	}
+	if gotSRV.Port != srv.Port || gotSRV.Target != srv.Target {
+		t.Errorf("ToSRV() = %+v, want port=%d target=%s", gotSRV, srv.Port, srv.Target)
+	}
+}
+
+func TestRecordConversionCAARoundTrip(t *testing.T) {
+	rec := libdns.Record{
+		Name:  "example.com",
+		Type:  "CAA",
+		Value: `0 issue "letsencrypt.org"`,
+		TTL:   300 * time.Second,
+	}
+
+	out := roundTrip(t, rec)
+
+	if out.Value != rec.Value {
+		t.Errorf("Value = %q, want %q", out.Value, rec.Value)
+	}
+}
+
+func TestRecordConversionTLSARoundTrip(t *testing.T) {
+	rec := libdns.Record{
+		Name:  "_443._tcp.example.com",
+		Type:  "TLSA",
+		Value: "3 1 1 abcdef0123456789",
+		TTL:   300 * time.Second,
+	}
+
+	out := roundTrip(t, rec)
+
+	if out.Value != rec.Value {
+		t.Errorf("Value = %q, want %q", out.Value, rec.Value)
+	}
+}
+
+func TestRecordConversionTTLAndIDRoundTrip(t *testing.T) {
+	rec := libdns.Record{
+		ID:    "rec-123",
+		Name:  "www",
+		Type:  "A",
+		Value: "1.2.3.4",
+		TTL:   90 * time.Second,
+	}
+
+	out := roundTrip(t, rec)
+
+	if out.ID != rec.ID {
+		t.Errorf("ID = %q, want %q", out.ID, rec.ID)
+	}
+	if out.TTL != rec.TTL {
+		t.Errorf("TTL = %v, want %v", out.TTL, rec.TTL)
+	}
+}
+
+func TestWaitForRetryUsesLargerOfBackoffAndRetryAfter(t *testing.T) {
+	p := &Provider{RetryInitialDelay: 10 * time.Millisecond}
+
+	start := time.Now()
+	if err := p.waitForRetry(context.Background(), 1, 200*time.Millisecond); err != nil {
+		t.Fatalf("waitForRetry: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// Attempt 1's backoff alone is well under 200ms, so if Retry-After and
+	// backoff stacked instead of combining, this would also pass; the real
+	// guard is TestWaitForRetryDoesNotStackWithNextAttempt below.
+	if elapsed < 200*time.Millisecond {
+		t.Fatalf("waited %v, expected at least the 200ms Retry-After", elapsed)
+	}
+}
+
+func TestWaitForRetryDoesNotStackWithNextAttempt(t *testing.T) {
+	p := &Provider{RetryInitialDelay: 100 * time.Millisecond, RetryMaxDelay: 100 * time.Millisecond}
+
+	start := time.Now()
+	if err := p.waitForRetry(context.Background(), 1, 100*time.Millisecond); err != nil {
+		t.Fatalf("waitForRetry: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	// Backoff for attempt 1 is 50-100ms here, never more than the 100ms
+	// Retry-After, so the wait should be that 100ms alone; stacking the
+	// backoff on top of it would take at least 150ms.
+	if elapsed > 150*time.Millisecond {
+		t.Fatalf("waited %v, expected the single ~100ms Retry-After wait, not backoff stacked on top", elapsed)
+	}
+}
+
+func TestRecordConversionSRVRejectsMalformedValue(t *testing.T) {
+	rec := libdns.Record{
+		Name:  "_sip._tcp.example.com",
+		Type:  "SRV",
+		Value: "not-a-valid-srv-value",
+	}
+
+	if _, err := libdnsRecordsToNamedropRecords([]libdns.Record{rec}); err == nil {
+		t.Fatal("expected an error for a malformed SRV value, got nil")
+	}
+}